@@ -31,7 +31,7 @@ type Node_t struct {
     NodeType NodeTypes_t
     Uuid string
     Description string
-    Datatype string
+    Datatype string  // for a PROPERTY node, this instead names the STRUCT node it belongs to
     Min string
     Max string
     Unit string
@@ -42,6 +42,22 @@ type Node_t struct {
     Children uint8
     Parent *Node_t
     Child []*Node_t
+    Properties []*Node_t  // for a STRUCT node, the subset of Child that are PROPERTY nodes
+}
+
+// PopulateProperties fills in node.Properties from node.Child. It is a
+// no-op for anything other than a STRUCT node, and is called once per node
+// right after its children have been read/attached.
+func PopulateProperties(node *Node_t) {
+    if (node.NodeType != STRUCT) {
+        return
+    }
+    node.Properties = nil
+    for _, child := range node.Child {
+        if (child.NodeType == PROPERTY) {
+            node.Properties = append(node.Properties, child)
+        }
+    }
 }
 
 func StringToNodetype(nodeType string) uint8 {
@@ -60,7 +76,7 @@ func StringToNodetype(nodeType string) uint8 {
     if (nodeType == "struct") {
         return STRUCT
     }
-    if (nodeType == "propery") {
+    if (nodeType == "property" || nodeType == "propery") {  // "propery" kept for trees written before the typo fix
         return PROPERTY
     }
     fmt.Printf("Unknown type! |%s|\n", nodeType);
@@ -97,7 +113,7 @@ func NodetypeToString(nodeType NodeTypes_t) string {
         return "struct"
     }
     if (nodeType == PROPERTY) {
-        return "propery"
+        return "property"
     }
     fmt.Printf("Unknown type! |%d|\n", nodeType);
     return ""
@@ -0,0 +1,379 @@
+/**
+* (C) 2020 Geotab Inc
+*
+* All files and artifacts in this repository are licensed under the
+* provisions of the license provided by the LICENSE file in this repository.
+*
+*
+* Context-cancelable tree I/O over an arbitrary io.ReaderAt/io.Writer,
+* for callers who cannot rely on the package-level treeFp (concurrent
+* searches, network streams, memory-mapped trees, request timeouts).
+**/
+
+package parserlib
+
+import (
+    "context"
+    "io"
+    "io/fs"
+
+    def "github.com/COVESA/vss-tools/binary/go_parser/datamodel"
+)
+
+// Parser owns the tree's backing storage instead of a package-level
+// *os.File, so a caller can read from an *os.File, a bytes.Reader, a
+// network stream, or a memory-mapped region, and drive several Parsers
+// over the same process concurrently.
+type Parser struct {
+    r      io.ReaderAt
+    w      io.Writer
+    cursor int64
+}
+
+// NewParser returns a Parser that reads the binary tree format from r,
+// starting at offset 0.
+func NewParser(r io.ReaderAt) *Parser {
+    return &Parser{r: r}
+}
+
+// NewTreeWriter returns a Parser that serializes a tree to w.
+func NewTreeWriter(w io.Writer) *Parser {
+    return &Parser{w: w}
+}
+
+func (p *Parser) readBytes(numOfBytes uint32) ([]byte, error) {
+    if (numOfBytes == 0) {
+        return nil, nil
+    }
+    buf := make([]byte, numOfBytes)
+    n, err := p.r.ReadAt(buf, p.cursor)
+    p.cursor += int64(n)
+    if (err != nil && err != io.EOF) {
+        return nil, err
+    }
+    if (n < int(numOfBytes)) {
+        return nil, io.ErrUnexpectedEOF
+    }
+    return buf, nil
+}
+
+func (p *Parser) readLenPrefixed(lenBytes uint32) (string, error) {
+    lenBuf, err := p.readBytes(lenBytes)
+    if (err != nil) {
+        return "", err
+    }
+    length := deSerializeUInt(lenBuf)
+    var n uint32
+    switch v := length.(type) {
+    case uint8:
+        n = uint32(v)
+    case uint16:
+        n = uint32(v)
+    }
+    if (n == 0) {
+        return "", nil
+    }
+    buf, err := p.readBytes(n)
+    if (err != nil) {
+        return "", err
+    }
+    return string(buf), nil
+}
+
+// populateNode reads a single node's fields, in the same order
+// populateNode in parser.go uses, but reading from p.r at p.cursor instead
+// of treeFp.
+func (p *Parser) populateNode(node *def.Node_t) error {
+    name, err := p.readLenPrefixed(1)
+    if (err != nil) {
+        return err
+    }
+    node.Name = name
+
+    nodeType, err := p.readLenPrefixed(1)
+    if (err != nil) {
+        return err
+    }
+    node.NodeType = (def.NodeTypes_t)(def.StringToNodetype(nodeType))
+
+    uuid, err := p.readLenPrefixed(1)
+    if (err != nil) {
+        return err
+    }
+    node.Uuid = uuid
+
+    descr, err := p.readLenPrefixed(2)
+    if (err != nil) {
+        return err
+    }
+    node.Description = descr
+
+    datatype, err := p.readLenPrefixed(1)
+    if (err != nil) {
+        return err
+    }
+    if (node.NodeType != def.BRANCH) {
+        node.Datatype = datatype
+    }
+
+    min, err := p.readLenPrefixed(1)
+    if (err != nil) {
+        return err
+    }
+    node.Min = min
+
+    max, err := p.readLenPrefixed(1)
+    if (err != nil) {
+        return err
+    }
+    node.Max = max
+
+    unit, err := p.readLenPrefixed(1)
+    if (err != nil) {
+        return err
+    }
+    node.Unit = unit
+
+    allowedStr, err := p.readLenPrefixed(2)
+    if (err != nil) {
+        return err
+    }
+    node.Allowed = (uint8)(countAllowedElements(allowedStr))
+    if (node.Allowed > 0) {
+        node.AllowedDef = make([]string, node.Allowed)
+    }
+    for i := 0 ; i < (int)(node.Allowed) ; i++ {
+        node.AllowedDef[i] = extractAllowedElement(allowedStr, i)
+    }
+
+    defaultAllowed, err := p.readLenPrefixed(1)
+    if (err != nil) {
+        return err
+    }
+    node.DefaultAllowed = defaultAllowed
+
+    validate, err := p.readLenPrefixed(1)
+    if (err != nil) {
+        return err
+    }
+    node.Validate = def.ValidateToInt(validate)
+
+    childrenBuf, err := p.readBytes(1)
+    if (err != nil) {
+        return err
+    }
+    node.Children = deSerializeUInt(childrenBuf).(uint8)
+    return nil
+}
+
+// ReadTree reads a full tree from p's reader, aborting with ctx.Err() as
+// soon as ctx is canceled or its deadline passes, checked before every
+// node is read.
+func (p *Parser) ReadTree(ctx context.Context) (*def.Node_t, error) {
+    p.cursor = 0
+    return p.readNode(ctx, nil)
+}
+
+func (p *Parser) readNode(ctx context.Context, parent *def.Node_t) (*def.Node_t, error) {
+    if err := ctx.Err(); err != nil {
+        return nil, err
+    }
+    var node def.Node_t
+    if err := p.populateNode(&node); err != nil {
+        return nil, err
+    }
+    node.Parent = parent
+    if (node.Children > 0) {
+        node.Child = make([]*def.Node_t, node.Children)
+    }
+    for i := uint8(0) ; i < node.Children ; i++ {
+        child, err := p.readNode(ctx, &node)
+        if (err != nil) {
+            return nil, err
+        }
+        node.Child[i] = child
+    }
+    def.PopulateProperties(&node)
+    return &node, nil
+}
+
+// WriteTree serializes root to p's writer, in the same on-disk order
+// writeNode in parser.go uses, aborting with ctx.Err() before each node.
+func (p *Parser) WriteTree(ctx context.Context, root *def.Node_t) error {
+    return p.writeNode(ctx, root)
+}
+
+func (p *Parser) writeNode(ctx context.Context, node *def.Node_t) error {
+    if err := ctx.Err(); err != nil {
+        return err
+    }
+    if err := p.writeField(uint8(len(node.Name)), node.Name); err != nil {
+        return err
+    }
+    nodeType := def.NodetypeToString(node.NodeType)
+    if err := p.writeField(uint8(len(nodeType)), nodeType); err != nil {
+        return err
+    }
+    if err := p.writeField(uint8(len(node.Uuid)), node.Uuid); err != nil {
+        return err
+    }
+    if err := p.writeField(uint16(len(node.Description)), node.Description); err != nil {
+        return err
+    }
+    datatype := node.Datatype
+    if (node.NodeType == def.BRANCH) {
+        datatype = ""
+    }
+    if err := p.writeField(uint8(len(datatype)), datatype); err != nil {
+        return err
+    }
+    if err := p.writeField(uint8(len(node.Min)), node.Min); err != nil {
+        return err
+    }
+    if err := p.writeField(uint8(len(node.Max)), node.Max); err != nil {
+        return err
+    }
+    if err := p.writeField(uint8(len(node.Unit)), node.Unit); err != nil {
+        return err
+    }
+    allowedStrLen := calculatAllowedStrLen(node.AllowedDef)
+    if _, err := p.w.Write(serializeUInt(uint16(allowedStrLen))); err != nil {
+        return err
+    }
+    for i := 0 ; i < (int)(node.Allowed) ; i++ {
+        if _, err := p.w.Write(intToHex(len(node.AllowedDef[i]))); err != nil {
+            return err
+        }
+        if _, err := p.w.Write([]byte(node.AllowedDef[i])); err != nil {
+            return err
+        }
+    }
+    if err := p.writeField(uint8(len(node.DefaultAllowed)), node.DefaultAllowed); err != nil {
+        return err
+    }
+    validate := def.ValidateToString(node.Validate)
+    if err := p.writeField(uint8(len(validate)), validate); err != nil {
+        return err
+    }
+    if _, err := p.w.Write(serializeUInt(uint8(node.Children))); err != nil {
+        return err
+    }
+
+    for i := uint8(0) ; i < node.Children ; i++ {
+        if err := p.writeNode(ctx, node.Child[i]); err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+func (p *Parser) writeField(length interface{}, value string) error {
+    if _, err := p.w.Write(serializeUInt(length)); err != nil {
+        return err
+    }
+    if (len(value) > 0) {
+        if _, err := p.w.Write([]byte(value)); err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+// SearchNodes is the context-aware counterpart to VSSsearchNodes: it
+// aborts the walk and returns ctx.Err() once ctx is canceled rather than
+// running the speculative match to completion.
+func (p *Parser) SearchNodes(ctx context.Context, searchPath string, rootNode *def.Node_t, maxFound int, anyDepth bool, leafNodesOnly bool, listSize int, noScopeList []string, validation *int) ([]SearchData_t, int, error) {
+    searchData, numOfMatches, maxValidation, err := searchNodesWalk(ctx, searchPath, rootNode, maxFound, anyDepth, leafNodesOnly, listSize, noScopeList)
+    if err != nil {
+        return searchData, numOfMatches, err
+    }
+    if (validation != nil) {
+        *validation = maxValidation
+    }
+    return searchData, numOfMatches, nil
+}
+
+// GetLeafNodesList is the context-aware counterpart to VSSGetLeafNodesList:
+// it writes the same "{"leafpaths":[...]}" document to p's writer, but
+// checks ctx before visiting every node instead of running to completion
+// unconditionally.
+func (p *Parser) GetLeafNodesList(ctx context.Context, rootNode *def.Node_t) (int, error) {
+    if _, err := p.w.Write([]byte("{\"leafpaths\":[")); err != nil {
+        return 0, err
+    }
+    numOfMatches := 0
+    walkErr := WalkTree(rootNode, TreeWalkHandler{
+        PreNode: func(path Path, node *def.Node_t) error {
+            if (path.Len() >= 2) {
+                parent := path.Segment(-2).Node
+                if (VSSgetType(parent) == def.STRUCT && VSSgetType(node) == def.PROPERTY && expandStructProperties == false) {
+                    return fs.SkipDir  // keep the STRUCT's internals opaque; the STRUCT itself still gets emitted below
+                }
+            }
+            return nil
+        },
+        Node: func(path Path, node *def.Node_t) error {
+            if err := ctx.Err(); err != nil {
+                return err
+            }
+            if (VSSgetType(node) == def.BRANCH) {
+                return nil
+            }
+            prefix := ", \""
+            if (numOfMatches == 0) {
+                prefix = "\""
+            }
+            if _, err := p.w.Write([]byte(prefix + path.String() + "\"")); err != nil {
+                return err
+            }
+            numOfMatches++
+            return nil
+        },
+    })
+    if (walkErr != nil) {
+        return numOfMatches, walkErr
+    }
+    _, err := p.w.Write([]byte("]}"))
+    return numOfMatches, err
+}
+
+// GetUuidList is the context-aware counterpart to VSSGetUuidList.
+func (p *Parser) GetUuidList(ctx context.Context, rootNode *def.Node_t) (int, error) {
+    if _, err := p.w.Write([]byte("{\"leafuuids\":[")); err != nil {
+        return 0, err
+    }
+    numOfMatches := 0
+    walkErr := WalkTree(rootNode, TreeWalkHandler{
+        PreNode: func(path Path, node *def.Node_t) error {
+            if (path.Len() >= 2) {
+                parent := path.Segment(-2).Node
+                if (VSSgetType(parent) == def.STRUCT && VSSgetType(node) == def.PROPERTY && expandStructProperties == false) {
+                    return fs.SkipDir  // keep the STRUCT's internals opaque; the STRUCT itself still gets emitted below
+                }
+            }
+            return nil
+        },
+        Node: func(path Path, node *def.Node_t) error {
+            if err := ctx.Err(); err != nil {
+                return err
+            }
+            if (VSSgetType(node) == def.BRANCH) {
+                return nil
+            }
+            prefix := ", {\"path\":\""
+            if (numOfMatches == 0) {
+                prefix = "{\"path\":\""
+            }
+            if _, err := p.w.Write([]byte(prefix + path.String() + "\", \"uuid\":\"" + VSSgetUUID(node) + "\"}")); err != nil {
+                return err
+            }
+            numOfMatches++
+            return nil
+        },
+    })
+    if (walkErr != nil) {
+        return numOfMatches, walkErr
+    }
+    _, err := p.w.Write([]byte("]}"))
+    return numOfMatches, err
+}
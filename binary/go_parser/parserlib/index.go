@@ -0,0 +1,287 @@
+/**
+* (C) 2020 Geotab Inc
+*
+* All files and artifacts in this repository are licensed under the
+* provisions of the license provided by the LICENSE file in this repository.
+*
+*
+* Path/description index for VSSsearchNodes, to avoid a linear tree walk
+* on every lookup.
+**/
+
+package parserlib
+
+import (
+    "bufio"
+    "fmt"
+    "io"
+    "os"
+    "sort"
+    "strings"
+
+    def "github.com/COVESA/vss-tools/binary/go_parser/datamodel"
+)
+
+// SearchResult is a single match returned by Index.Search.
+type SearchResult struct {
+    Path string
+    Node *def.Node_t
+}
+
+// Index is a once-built lookup structure over a VSS tree: an exact
+// path->node map, plus trigram posting lists over paths and descriptions
+// that narrow candidates before pathMatchesPattern confirms them.
+type Index struct {
+    byPath        map[string]*def.Node_t
+    pathTrigrams  map[string][]string // trigram -> paths containing it
+    descrTrigrams map[string][]string // trigram -> paths whose description contains it
+}
+
+const indexSidecarSuffix = ".idx"
+
+// VSSBuildIndex walks root once and builds an Index over every node in the
+// tree. Build cost is paid once; lookups through Index.Search and the
+// index-aware VSSsearchNodes path are then O(1)/O(matching trigrams).
+func VSSBuildIndex(root *def.Node_t) *Index {
+    idx := &Index{
+        byPath:        make(map[string]*def.Node_t),
+        pathTrigrams:  make(map[string][]string),
+        descrTrigrams: make(map[string][]string),
+    }
+    idx.indexNode(root, VSSgetName(root))
+    return idx
+}
+
+func (idx *Index) indexNode(node *def.Node_t, path string) {
+    idx.byPath[path] = node
+    for _, tri := range trigrams(strings.ToLower(path)) {
+        idx.pathTrigrams[tri] = append(idx.pathTrigrams[tri], path)
+    }
+    if descr := VSSgetDescr(node); descr != "" {
+        for _, tri := range trigrams(strings.ToLower(descr)) {
+            idx.descrTrigrams[tri] = append(idx.descrTrigrams[tri], path)
+        }
+    }
+    for i := 0; i < VSSgetNumOfChildren(node); i++ {
+        child := VSSgetChild(node, i)
+        idx.indexNode(child, path+"."+VSSgetName(child))
+    }
+}
+
+func trigrams(s string) []string {
+    if len(s) < 3 {
+        return []string{s}
+    }
+    out := make([]string, 0, len(s)-2)
+    for i := 0; i+3 <= len(s); i++ {
+        out = append(out, s[i:i+3])
+    }
+    return out
+}
+
+// Lookup returns the node at an exact dotted path in O(1), or nil.
+func (idx *Index) Lookup(path string) *def.Node_t {
+    return idx.byPath[path]
+}
+
+// Search resolves a path pattern (which may contain "*" wildcard segments)
+// or a free-text fragment against the index. Candidate paths are first
+// narrowed via the trigram posting lists, then confirmed against pattern
+// and description, up to limit results (limit <= 0 means unlimited).
+func (idx *Index) Search(pattern string, limit int) []SearchResult {
+    if node, ok := idx.byPath[pattern]; ok {
+        return []SearchResult{{Path: pattern, Node: node}}
+    }
+
+    candidates := idx.candidatePaths(pattern, true)
+    sort.Strings(candidates)
+
+    var results []SearchResult
+    for _, path := range candidates {
+        if !pathMatchesPattern(path, pattern) && !strings.Contains(strings.ToLower(idx.descrOf(path)), strings.ToLower(pattern)) {
+            continue
+        }
+        results = append(results, SearchResult{Path: path, Node: idx.byPath[path]})
+        if limit > 0 && len(results) >= limit {
+            break
+        }
+    }
+    return results
+}
+
+// SearchPaths resolves pattern against indexed paths only, never against
+// Description text. It is what VSSsearchNodes calls through when an index
+// is in play, so opting into VSSBuildIndex/VSSUseIndex cannot widen a path
+// query into a description search; Search above remains the only entry
+// point that looks at descriptions.
+func (idx *Index) SearchPaths(pattern string, limit int) []SearchResult {
+    if node, ok := idx.byPath[pattern]; ok {
+        return []SearchResult{{Path: pattern, Node: node}}
+    }
+
+    candidates := idx.candidatePaths(pattern, false)
+    sort.Strings(candidates)
+
+    var results []SearchResult
+    for _, path := range candidates {
+        if !pathMatchesPattern(path, pattern) {
+            continue
+        }
+        results = append(results, SearchResult{Path: path, Node: idx.byPath[path]})
+        if limit > 0 && len(results) >= limit {
+            break
+        }
+    }
+    return results
+}
+
+func (idx *Index) descrOf(path string) string {
+    if node, ok := idx.byPath[path]; ok {
+        return VSSgetDescr(node)
+    }
+    return ""
+}
+
+// candidatePaths narrows the full path set down using the trigrams present
+// in pattern, falling back to every indexed path when the pattern is too
+// short to produce any trigram (e.g. a single wildcard segment).
+// includeDescr also pulls in candidates whose description contains one of
+// pattern's trigrams; SearchPaths passes false so a path-only query can
+// never surface a description-only match.
+func (idx *Index) candidatePaths(pattern string, includeDescr bool) []string {
+    lowered := strings.ToLower(strings.ReplaceAll(pattern, "*", ""))
+    tris := trigrams(lowered)
+    seen := make(map[string]bool)
+    var out []string
+    if len(lowered) < 3 {
+        for path := range idx.byPath {
+            out = append(out, path)
+        }
+        return out
+    }
+    for _, tri := range tris {
+        for _, path := range idx.pathTrigrams[tri] {
+            if !seen[path] {
+                seen[path] = true
+                out = append(out, path)
+            }
+        }
+        if includeDescr {
+            for _, path := range idx.descrTrigrams[tri] {
+                if !seen[path] {
+                    seen[path] = true
+                    out = append(out, path)
+                }
+            }
+        }
+    }
+    return out
+}
+
+// pathMatchesPattern supports "*" as a single-segment wildcard and "**" as
+// a multi-segment wildcard, mirroring the glob conventions used elsewhere
+// by VSSsearchNodes.
+func pathMatchesPattern(path string, pattern string) bool {
+    pathSegs := strings.Split(path, ".")
+    patSegs := strings.Split(pattern, ".")
+    return matchSegments(pathSegs, patSegs)
+}
+
+func matchSegments(path []string, pattern []string) bool {
+    if len(pattern) == 0 {
+        return len(path) == 0
+    }
+    switch pattern[0] {
+    case "**":
+        if matchSegments(path, pattern[1:]) {
+            return true
+        }
+        if len(path) == 0 {
+            return false
+        }
+        return matchSegments(path[1:], pattern)
+    case "*":
+        if len(path) == 0 {
+            return false
+        }
+        return matchSegments(path[1:], pattern[1:])
+    default:
+        if len(path) == 0 || path[0] != pattern[0] {
+            return false
+        }
+        return matchSegments(path[1:], pattern[1:])
+    }
+}
+
+// WriteTo persists the index next to a binary tree file written by
+// VSSWriteTree, so the (re)build cost is paid once per deployment rather
+// than on every process start.
+func (idx *Index) WriteTo(treeFname string) error {
+    f, err := os.OpenFile(sidecarName(treeFname), os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+    if err != nil {
+        return fmt.Errorf("could not open index sidecar %s: %w", sidecarName(treeFname), err)
+    }
+    defer f.Close()
+
+    w := bufio.NewWriter(f)
+    paths := make([]string, 0, len(idx.byPath))
+    for path := range idx.byPath {
+        paths = append(paths, path)
+    }
+    sort.Strings(paths)
+    for _, path := range paths {
+        fmt.Fprintf(w, "%s\n", path)
+    }
+    return w.Flush()
+}
+
+// ReadIndex rebuilds the path set previously written by WriteTo, resolving
+// each path against root so Index.Lookup/Search work without re-walking the
+// tree from scratch.
+func ReadIndex(treeFname string, root *def.Node_t) (*Index, error) {
+    f, err := os.Open(sidecarName(treeFname))
+    if err != nil {
+        return nil, fmt.Errorf("could not open index sidecar %s: %w", sidecarName(treeFname), err)
+    }
+    defer f.Close()
+
+    idx := &Index{
+        byPath:        make(map[string]*def.Node_t),
+        pathTrigrams:  make(map[string][]string),
+        descrTrigrams: make(map[string][]string),
+    }
+    scanner := bufio.NewScanner(f)
+    for scanner.Scan() {
+        path := scanner.Text()
+        if node := findNodeByPath(root, path); node != nil {
+            idx.byPath[path] = node
+            for _, tri := range trigrams(strings.ToLower(path)) {
+                idx.pathTrigrams[tri] = append(idx.pathTrigrams[tri], path)
+            }
+            if descr := VSSgetDescr(node); descr != "" {
+                for _, tri := range trigrams(strings.ToLower(descr)) {
+                    idx.descrTrigrams[tri] = append(idx.descrTrigrams[tri], path)
+                }
+            }
+        }
+    }
+    if err := scanner.Err(); err != nil && err != io.EOF {
+        return nil, err
+    }
+    return idx, nil
+}
+
+func sidecarName(treeFname string) string {
+    return treeFname + indexSidecarSuffix
+}
+
+// builtIndex is the index a caller has opted into via VSSUseIndex; when set,
+// VSSsearchNodes answers from it instead of calling searchNodesWalk, unless
+// a noScopeList is given.
+var builtIndex *Index
+
+// VSSUseIndex registers idx as the index VSSsearchNodes should consult. Pass
+// nil to go back to a plain tree walk.
+func VSSUseIndex(idx *Index) {
+    builtIndex = idx
+}
@@ -0,0 +1,66 @@
+/**
+* (C) 2020 Geotab Inc
+*
+* All files and artifacts in this repository are licensed under the
+* provisions of the license provided by the LICENSE file in this repository.
+*
+*
+* Range-over-func iterators over the VSS tree, built on top of WalkTree.
+**/
+
+package parserlib
+
+import (
+    "io/fs"
+    "iter"
+
+    def "github.com/COVESA/vss-tools/binary/go_parser/datamodel"
+)
+
+// VSSLeafNodes streams every leaf node reachable from root as (path, node)
+// pairs, without the maxFound cap VSSsearchNodes needs. The walk stops as
+// soon as the consumer breaks out of the range
+// loop.
+func VSSLeafNodes(root *def.Node_t) iter.Seq2[Path, *def.Node_t] {
+    return func(yield func(Path, *def.Node_t) bool) {
+        WalkTree(root, TreeWalkHandler{
+            PreNode: func(path Path, node *def.Node_t) error {
+                if (path.Len() >= 2) {
+                    parent := path.Segment(-2).Node
+                    if (VSSgetType(parent) == def.STRUCT && VSSgetType(node) == def.PROPERTY && expandStructProperties == false) {
+                        return fs.SkipDir  // keep the STRUCT's internals opaque; the STRUCT itself is still yielded below
+                    }
+                }
+                return nil
+            },
+            Node: func(path Path, node *def.Node_t) error {
+                if (VSSgetType(node) == def.BRANCH) {
+                    return nil
+                }
+                if (yield(path, node) == false) {
+                    return fs.SkipAll
+                }
+                return nil
+            },
+        })
+    }
+}
+
+// VSSMatch streams every (path, node) pair under root whose path matches
+// pattern (which may use "*"/"**" wildcard segments, as in
+// pathMatchesPattern), again stopping cleanly on an early break.
+func VSSMatch(root *def.Node_t, pattern string) iter.Seq2[Path, *def.Node_t] {
+    return func(yield func(Path, *def.Node_t) bool) {
+        WalkTree(root, TreeWalkHandler{
+            Node: func(path Path, node *def.Node_t) error {
+                if (pathMatchesPattern(path.String(), pattern) == false) {
+                    return nil
+                }
+                if (yield(path, node) == false) {
+                    return fs.SkipAll
+                }
+                return nil
+            },
+        })
+    }
+}
@@ -0,0 +1,395 @@
+/**
+* (C) 2020 Geotab Inc
+*
+* All files and artifacts in this repository are licensed under the
+* provisions of the license provided by the LICENSE file in this repository.
+*
+*
+* Reflection based (un)marshalling of Go structs against a VSS binary tree.
+**/
+
+package parserlib
+
+import (
+    "encoding/binary"
+    "fmt"
+    "math"
+    "reflect"
+    "strconv"
+    "strings"
+
+    def "github.com/COVESA/vss-tools/binary/go_parser/datamodel"
+)
+
+// MarshalError is returned by VSSMarshal/VSSUnmarshal/VSSBindStruct when a
+// struct field could not be matched against the VSS tree, or its value does
+// not satisfy the node it was matched to.
+type MarshalError struct {
+    Path   string
+    Reason string
+}
+
+func (e *MarshalError) Error() string {
+    return fmt.Sprintf("vss marshal: %s: %s", e.Path, e.Reason)
+}
+
+// binding ties a struct field to the VSS node its value is read from/written to.
+type binding struct {
+    path  string
+    node  *def.Node_t
+    value reflect.Value
+}
+
+// VSSBindStruct matches every exported field of v (directly, or recursively
+// through nested structs) to a node under root, using the "vss" struct tag
+// as an override for the dotted path and falling back to the field name
+// otherwise. It returns an error naming the dotted path of the first field
+// that could not be resolved.
+func VSSBindStruct(root *def.Node_t, v any) error {
+    _, err := bindStruct(root, VSSgetName(root), reflect.ValueOf(v))
+    return err
+}
+
+func bindStruct(root *def.Node_t, basePath string, rv reflect.Value) ([]binding, error) {
+    for rv.Kind() == reflect.Ptr {
+        if rv.IsNil() {
+            return nil, &MarshalError{Path: basePath, Reason: "nil pointer"}
+        }
+        rv = rv.Elem()
+    }
+    if rv.Kind() != reflect.Struct {
+        return nil, &MarshalError{Path: basePath, Reason: "value is not a struct"}
+    }
+
+    var bindings []binding
+    rt := rv.Type()
+    for i := 0; i < rt.NumField(); i++ {
+        field := rt.Field(i)
+        if field.PkgPath != "" { // unexported
+            continue
+        }
+        path := field.Tag.Get("vss")
+        if path == "" {
+            path = basePath + "." + field.Name
+        }
+        node := findNodeByPath(root, path)
+        if node == nil {
+            return nil, &MarshalError{Path: path, Reason: "no matching VSS node"}
+        }
+        fv := rv.Field(i)
+        if fv.Kind() == reflect.Struct && VSSgetNumOfChildren(node) > 0 {
+            nested, err := bindStruct(root, path, fv)
+            if err != nil {
+                return nil, err
+            }
+            bindings = append(bindings, nested...)
+            continue
+        }
+        bindings = append(bindings, binding{path: path, node: node, value: fv})
+    }
+    return bindings, nil
+}
+
+// findNodeByPath resolves a dotted path (rooted at root's own name) to the
+// node it identifies, or nil if no such node exists.
+func findNodeByPath(root *def.Node_t, path string) *def.Node_t {
+    segments := strings.Split(path, ".")
+    if len(segments) == 0 || segments[0] != VSSgetName(root) {
+        return nil
+    }
+    current := root
+    for _, seg := range segments[1:] {
+        var next *def.Node_t
+        for i := 0; i < VSSgetNumOfChildren(current); i++ {
+            child := VSSgetChild(current, i)
+            if VSSgetName(child) == seg {
+                next = child
+                break
+            }
+        }
+        if next == nil {
+            return nil
+        }
+        current = next
+    }
+    return current
+}
+
+// VSSMarshal walks v with reflection, validates every matched field against
+// the Allowed/Min/Max of its VSS node, and encodes the values in struct
+// field order into a flat byte stream. The node's Datatype is not compared
+// with the field's Go kind.
+func VSSMarshal(root *def.Node_t, v any) ([]byte, error) {
+    bindings, err := bindStruct(root, VSSgetName(root), reflect.ValueOf(v))
+    if err != nil {
+        return nil, err
+    }
+    var buf []byte
+    for _, b := range bindings {
+        encoded, err := marshalValue(b.path, b.node, b.value)
+        if err != nil {
+            return nil, err
+        }
+        buf = append(buf, encoded...)
+    }
+    return buf, nil
+}
+
+// VSSUnmarshal is the inverse of VSSMarshal: it decodes data in struct field
+// order into v, validating each value against the VSS node it is bound to.
+func VSSUnmarshal(root *def.Node_t, data []byte, v any) error {
+    bindings, err := bindStruct(root, VSSgetName(root), reflect.ValueOf(v))
+    if err != nil {
+        return err
+    }
+    for _, b := range bindings {
+        n, err := unmarshalValue(b.path, b.node, data, b.value)
+        if err != nil {
+            return err
+        }
+        data = data[n:]
+    }
+    return nil
+}
+
+func marshalValue(path string, node *def.Node_t, fv reflect.Value) ([]byte, error) {
+    if err := validateValue(path, node, fv); err != nil {
+        return nil, err
+    }
+    switch fv.Kind() {
+    case reflect.Bool:
+        if fv.Bool() {
+            return []byte{1}, nil
+        }
+        return []byte{0}, nil
+    case reflect.Uint8:
+        return []byte{byte(fv.Uint())}, nil
+    case reflect.Uint16:
+        buf := make([]byte, 2)
+        binary.LittleEndian.PutUint16(buf, uint16(fv.Uint()))
+        return buf, nil
+    case reflect.Uint32:
+        buf := make([]byte, 4)
+        binary.LittleEndian.PutUint32(buf, uint32(fv.Uint()))
+        return buf, nil
+    case reflect.Uint64, reflect.Uint:
+        buf := make([]byte, 8)
+        binary.LittleEndian.PutUint64(buf, fv.Uint())
+        return buf, nil
+    case reflect.Int8:
+        return []byte{byte(fv.Int())}, nil
+    case reflect.Int16:
+        buf := make([]byte, 2)
+        binary.LittleEndian.PutUint16(buf, uint16(fv.Int()))
+        return buf, nil
+    case reflect.Int32:
+        buf := make([]byte, 4)
+        binary.LittleEndian.PutUint32(buf, uint32(fv.Int()))
+        return buf, nil
+    case reflect.Int64, reflect.Int:
+        buf := make([]byte, 8)
+        binary.LittleEndian.PutUint64(buf, uint64(fv.Int()))
+        return buf, nil
+    case reflect.Float32:
+        buf := make([]byte, 4)
+        binary.LittleEndian.PutUint32(buf, math.Float32bits(float32(fv.Float())))
+        return buf, nil
+    case reflect.Float64:
+        buf := make([]byte, 8)
+        binary.LittleEndian.PutUint64(buf, math.Float64bits(fv.Float()))
+        return buf, nil
+    case reflect.String:
+        s := fv.String()
+        prefix := make([]byte, 2)
+        binary.LittleEndian.PutUint16(prefix, uint16(len(s)))
+        return append(prefix, []byte(s)...), nil
+    case reflect.Slice:
+        prefix := make([]byte, 4)
+        binary.LittleEndian.PutUint32(prefix, uint32(fv.Len()))
+        buf := prefix
+        for i := 0; i < fv.Len(); i++ {
+            elemBuf, err := marshalValue(fmt.Sprintf("%s[%d]", path, i), node, fv.Index(i))
+            if err != nil {
+                return nil, err
+            }
+            buf = append(buf, elemBuf...)
+        }
+        return buf, nil
+    case reflect.Struct:
+        bindings, err := bindStruct(node, VSSgetName(node), fv)
+        if err != nil {
+            return nil, err
+        }
+        var buf []byte
+        for _, b := range bindings {
+            rel := strings.TrimPrefix(b.path, VSSgetName(node)+".")
+            encoded, err := marshalValue(path+"."+rel, b.node, b.value)
+            if err != nil {
+                return nil, err
+            }
+            buf = append(buf, encoded...)
+        }
+        return buf, nil
+    default:
+        return nil, &MarshalError{Path: path, Reason: fmt.Sprintf("unsupported kind %s", fv.Kind())}
+    }
+}
+
+func unmarshalValue(path string, node *def.Node_t, data []byte, fv reflect.Value) (int, error) {
+    switch fv.Kind() {
+    case reflect.Bool:
+        if len(data) < 1 {
+            return 0, &MarshalError{Path: path, Reason: "truncated bool"}
+        }
+        fv.SetBool(data[0] != 0)
+        return 1, validateValue(path, node, fv)
+    case reflect.Uint8:
+        if len(data) < 1 {
+            return 0, &MarshalError{Path: path, Reason: "truncated uint8"}
+        }
+        fv.SetUint(uint64(data[0]))
+        return 1, validateValue(path, node, fv)
+    case reflect.Uint16:
+        if len(data) < 2 {
+            return 0, &MarshalError{Path: path, Reason: "truncated uint16"}
+        }
+        fv.SetUint(uint64(binary.LittleEndian.Uint16(data)))
+        return 2, validateValue(path, node, fv)
+    case reflect.Uint32:
+        if len(data) < 4 {
+            return 0, &MarshalError{Path: path, Reason: "truncated uint32"}
+        }
+        fv.SetUint(uint64(binary.LittleEndian.Uint32(data)))
+        return 4, validateValue(path, node, fv)
+    case reflect.Uint64, reflect.Uint:
+        if len(data) < 8 {
+            return 0, &MarshalError{Path: path, Reason: "truncated uint64"}
+        }
+        fv.SetUint(binary.LittleEndian.Uint64(data))
+        return 8, validateValue(path, node, fv)
+    case reflect.Int8:
+        if len(data) < 1 {
+            return 0, &MarshalError{Path: path, Reason: "truncated int8"}
+        }
+        fv.SetInt(int64(int8(data[0])))
+        return 1, validateValue(path, node, fv)
+    case reflect.Int16:
+        if len(data) < 2 {
+            return 0, &MarshalError{Path: path, Reason: "truncated int16"}
+        }
+        fv.SetInt(int64(int16(binary.LittleEndian.Uint16(data))))
+        return 2, validateValue(path, node, fv)
+    case reflect.Int32:
+        if len(data) < 4 {
+            return 0, &MarshalError{Path: path, Reason: "truncated int32"}
+        }
+        fv.SetInt(int64(int32(binary.LittleEndian.Uint32(data))))
+        return 4, validateValue(path, node, fv)
+    case reflect.Int64, reflect.Int:
+        if len(data) < 8 {
+            return 0, &MarshalError{Path: path, Reason: "truncated int64"}
+        }
+        fv.SetInt(int64(binary.LittleEndian.Uint64(data)))
+        return 8, validateValue(path, node, fv)
+    case reflect.Float32:
+        if len(data) < 4 {
+            return 0, &MarshalError{Path: path, Reason: "truncated float32"}
+        }
+        fv.SetFloat(float64(math.Float32frombits(binary.LittleEndian.Uint32(data))))
+        return 4, validateValue(path, node, fv)
+    case reflect.Float64:
+        if len(data) < 8 {
+            return 0, &MarshalError{Path: path, Reason: "truncated float64"}
+        }
+        fv.SetFloat(math.Float64frombits(binary.LittleEndian.Uint64(data)))
+        return 8, validateValue(path, node, fv)
+    case reflect.String:
+        if len(data) < 2 {
+            return 0, &MarshalError{Path: path, Reason: "truncated string length"}
+        }
+        strLen := int(binary.LittleEndian.Uint16(data))
+        if len(data) < 2+strLen {
+            return 0, &MarshalError{Path: path, Reason: "truncated string"}
+        }
+        fv.SetString(string(data[2 : 2+strLen]))
+        return 2 + strLen, validateValue(path, node, fv)
+    case reflect.Slice:
+        if len(data) < 4 {
+            return 0, &MarshalError{Path: path, Reason: "truncated slice length"}
+        }
+        count := int(binary.LittleEndian.Uint32(data))
+        consumed := 4
+        slice := reflect.MakeSlice(fv.Type(), count, count)
+        for i := 0; i < count; i++ {
+            n, err := unmarshalValue(fmt.Sprintf("%s[%d]", path, i), node, data[consumed:], slice.Index(i))
+            if err != nil {
+                return 0, err
+            }
+            consumed += n
+        }
+        fv.Set(slice)
+        return consumed, nil
+    case reflect.Struct:
+        bindings, err := bindStruct(node, VSSgetName(node), fv)
+        if err != nil {
+            return 0, err
+        }
+        consumed := 0
+        for _, b := range bindings {
+            rel := strings.TrimPrefix(b.path, VSSgetName(node)+".")
+            n, err := unmarshalValue(path+"."+rel, b.node, data, b.value)
+            if err != nil {
+                return 0, err
+            }
+            data = data[n:]
+            consumed += n
+        }
+        return consumed, nil
+    default:
+        return 0, &MarshalError{Path: path, Reason: fmt.Sprintf("unsupported kind %s", fv.Kind())}
+    }
+}
+
+// validateValue checks a scalar value against the Min/Max/Allowed
+// constraints carried by its VSS node. Slices and branch-only nodes are not
+// range checked.
+func validateValue(path string, node *def.Node_t, fv reflect.Value) error {
+    switch fv.Kind() {
+    case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+        return validateNumeric(path, node, float64(fv.Int()))
+    case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+        return validateNumeric(path, node, float64(fv.Uint()))
+    case reflect.Float32, reflect.Float64:
+        return validateNumeric(path, node, fv.Float())
+    case reflect.String:
+        return validateAllowed(path, node, fv.String())
+    default:
+        return nil
+    }
+}
+
+func validateNumeric(path string, node *def.Node_t, val float64) error {
+    if node.Min != "" {
+        if min, err := strconv.ParseFloat(node.Min, 64); err == nil && val < min {
+            return &MarshalError{Path: path, Reason: fmt.Sprintf("value %v below minimum %v", val, min)}
+        }
+    }
+    if node.Max != "" {
+        if max, err := strconv.ParseFloat(node.Max, 64); err == nil && val > max {
+            return &MarshalError{Path: path, Reason: fmt.Sprintf("value %v above maximum %v", val, max)}
+        }
+    }
+    return nil
+}
+
+func validateAllowed(path string, node *def.Node_t, val string) error {
+    if VSSgetNumOfAllowedElements(node) == 0 {
+        return nil
+    }
+    for i := 0; i < VSSgetNumOfAllowedElements(node); i++ {
+        if VSSgetAllowedElement(node, i) == val {
+            return nil
+        }
+    }
+    return &MarshalError{Path: path, Reason: fmt.Sprintf("value %q not in allowed list", val)}
+}
@@ -0,0 +1,164 @@
+/**
+* (C) 2020 Geotab Inc
+*
+* All files and artifacts in this repository are licensed under the
+* provisions of the license provided by the LICENSE file in this repository.
+*
+*
+* UUID/path secondary index over a loaded VSS tree, built once at load
+* time instead of re-walking the tree for every lookup.
+**/
+
+package parserlib
+
+import (
+    "bufio"
+    "fmt"
+    "os"
+    "sort"
+    "strings"
+
+    def "github.com/COVESA/vss-tools/binary/go_parser/datamodel"
+)
+
+// NodeIndex resolves a loaded tree's nodes by UUID or by full dotted path,
+// and its ParentOf map mirrors Node_t.Parent keyed by UUID for callers that
+// only have a UUID in hand.
+type NodeIndex struct {
+    ByUUID   map[string]*def.Node_t
+    ByPath   map[string]*def.Node_t
+    ParentOf map[string]*def.Node_t // uuid -> parent node
+}
+
+func newNodeIndex() *NodeIndex {
+    return &NodeIndex{
+        ByUUID:   make(map[string]*def.Node_t),
+        ByPath:   make(map[string]*def.Node_t),
+        ParentOf: make(map[string]*def.Node_t),
+    }
+}
+
+// activeNodeIndex accumulates UUID/parent entries while traverseAndReadNode
+// is walking a tree being read by VSSReadTree; lastNodeIndex is the
+// completed index from the most recently read tree.
+var activeNodeIndex *NodeIndex
+var lastNodeIndex *NodeIndex
+
+func registerNodeIndex(node *def.Node_t) {
+    if (activeNodeIndex == nil || node.Uuid == "") {
+        return
+    }
+    activeNodeIndex.ByUUID[node.Uuid] = node
+    if (node.Parent != nil) {
+        activeNodeIndex.ParentOf[node.Uuid] = node.Parent
+    }
+}
+
+// buildNodeIndex derives a full NodeIndex (UUID, path and parent maps) from
+// an already-loaded tree.
+func buildNodeIndex(root *def.Node_t) *NodeIndex {
+    idx := newNodeIndex()
+    WalkTree(root, TreeWalkHandler{
+        Node: func(path Path, node *def.Node_t) error {
+            idx.ByPath[path.String()] = node
+            if (node.Uuid != "") {
+                idx.ByUUID[node.Uuid] = node
+                if (node.Parent != nil) {
+                    idx.ParentOf[node.Uuid] = node.Parent
+                }
+            }
+            return nil
+        },
+    })
+    return idx
+}
+
+// VSSLookupByUUID resolves a node by UUID against the index built by the
+// most recent VSSReadTree call, in O(1).
+func VSSLookupByUUID(uuid string) *def.Node_t {
+    if (lastNodeIndex == nil) {
+        return nil
+    }
+    return lastNodeIndex.ByUUID[uuid]
+}
+
+// VSSLookupByPath resolves a node by its full dotted path against the
+// index built by the most recent VSSReadTree call, in O(1).
+func VSSLookupByPath(path string) *def.Node_t {
+    if (lastNodeIndex == nil) {
+        return nil
+    }
+    return lastNodeIndex.ByPath[path]
+}
+
+// VSSAncestors returns node's ancestors, nearest first, up to the tree
+// root.
+func VSSAncestors(node *def.Node_t) []*def.Node_t {
+    var ancestors []*def.Node_t
+    for p := node.Parent ; p != nil ; p = p.Parent {
+        ancestors = append(ancestors, p)
+    }
+    return ancestors
+}
+
+const nodeIndexSidecarSuffix = ".nodeidx"
+
+// WriteTo persists idx next to a binary tree file written by VSSWriteTree,
+// as "<uuid>\t<path>" lines, so a server can load it with ReadNodeIndex and
+// skip the O(N) walk VSSReadTree would otherwise need to rebuild it.
+func (idx *NodeIndex) WriteTo(treeFname string) error {
+    f, err := os.OpenFile(nodeIndexSidecarName(treeFname), os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+    if (err != nil) {
+        return fmt.Errorf("could not open node index sidecar %s: %w", nodeIndexSidecarName(treeFname), err)
+    }
+    defer f.Close()
+
+    paths := make([]string, 0, len(idx.ByPath))
+    for path := range idx.ByPath {
+        paths = append(paths, path)
+    }
+    sort.Strings(paths)
+
+    w := bufio.NewWriter(f)
+    for _, path := range paths {
+        node := idx.ByPath[path]
+        fmt.Fprintf(w, "%s\t%s\n", node.Uuid, path)
+    }
+    return w.Flush()
+}
+
+// ReadNodeIndex rebuilds a NodeIndex previously written by WriteTo,
+// resolving each path against root.
+func ReadNodeIndex(treeFname string, root *def.Node_t) (*NodeIndex, error) {
+    f, err := os.Open(nodeIndexSidecarName(treeFname))
+    if (err != nil) {
+        return nil, fmt.Errorf("could not open node index sidecar %s: %w", nodeIndexSidecarName(treeFname), err)
+    }
+    defer f.Close()
+
+    idx := newNodeIndex()
+    scanner := bufio.NewScanner(f)
+    for scanner.Scan() {
+        fields := strings.SplitN(scanner.Text(), "\t", 2)
+        if (len(fields) != 2) {
+            continue
+        }
+        uuid, path := fields[0], fields[1]
+        node := findNodeByPath(root, path)
+        if (node == nil) {
+            continue
+        }
+        idx.ByPath[path] = node
+        if (uuid != "") {
+            idx.ByUUID[uuid] = node
+            if (node.Parent != nil) {
+                idx.ParentOf[uuid] = node.Parent
+            }
+        }
+    }
+    return idx, scanner.Err()
+}
+
+func nodeIndexSidecarName(treeFname string) string {
+    return treeFname + nodeIndexSidecarSuffix
+}
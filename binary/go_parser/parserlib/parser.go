@@ -12,9 +12,12 @@ package parserlib
 
 import (
     def "github.com/COVESA/vss-tools/binary/go_parser/datamodel"
+    "context"
+    "fmt"
+    "io"
+    "io/fs"
     "os"
     "strings"
-    "fmt"
 )
 
 var treeFp *os.File
@@ -26,8 +29,29 @@ type ReadTreeMetadata_t struct {
 }
 var readTreeMetadata ReadTreeMetadata_t
 
-var isGetLeafNodeList bool
-var isGetUuidList bool
+// expandStructProperties controls whether a traversal descends into the
+// PROPERTY children of a STRUCT node (true) or treats the STRUCT as an
+// opaque leaf-like node (false, the default).
+var expandStructProperties bool
+
+// VSSSetExpandStructProperties toggles whether searches/leaf listings
+// expand STRUCT nodes into their PROPERTY children or hide those internals
+// behind the STRUCT node itself.
+func VSSSetExpandStructProperties(expand bool) {
+	expandStructProperties = expand
+}
+
+// readErrorHandler, when set, is consulted for every WalkError encountered
+// while reading a tree in VSSReadTree: returning nil from it keeps the
+// best-effort node and continues the read, while returning an error aborts
+// it. Leaving it unset means the first read error aborts the read.
+var readErrorHandler func(*WalkError) error
+
+// VSSSetReadErrorHandler installs h as the read-time error handler. Pass
+// nil to restore the default abort-on-first-error behavior.
+func VSSSetReadErrorHandler(h func(*WalkError) error) {
+	readErrorHandler = h
+}
 
 const MAXFOUNDNODES = 1500
 type SearchData_t struct {
@@ -35,24 +59,6 @@ type SearchData_t struct {
     NodeHandle *def.Node_t
 }
 
-type SearchContext_t struct {
-	RootNode *def.Node_t
-	MaxFound int
-	LeafNodesOnly bool
-	MaxDepth int
-	SearchPath string
-	MatchPath string
-	CurrentDepth int  // depth in tree from rootNode, and also depth (in segments) in searchPath
-	SpeculationIndex int  // inc/dec when pathsegment in focus is wildcard
-	SpeculativeMatches [20]int  // inc when matching node is saved
-	MaxValidation int
-	NumOfMatches int
-	SearchData []SearchData_t
-	ListSize int
-	NoScopeList []string
-	ListFp *os.File
-}
-
 func initReadMetadata() {
 	readTreeMetadata.CurrentDepth = 0
 	readTreeMetadata.MaxTreeDepth = 0
@@ -126,20 +132,42 @@ func extractAllowedElement(allowedBuf string, elemIndex int) string {
     return allowedBuf[allowedstart:allowedend]
 }
 
-func traverseAndReadNode(parentNode *def.Node_t) *def.Node_t {
+// traverseAndReadNode reads one node (and, recursively, its children). A
+// read error is wrapped in a *WalkError with its node path; if
+// readErrorHandler is set and it swallows the error (returns nil), the error
+// is recorded onto errs, the best-effort node (zero-valued from the failed
+// field onward) is kept and the walk continues, otherwise the error aborts
+// the read.
+func traverseAndReadNode(parentNode *def.Node_t, path Path, errs *Errs) (*def.Node_t, error) {
 	var thisNode def.Node_t
 	updateReadMetadata(true)
-	populateNode(&thisNode)
+	if err := populateNode(&thisNode); err != nil {
+		werr := &WalkError{Path: path, NodeName: thisNode.Name, Err: err}
+		if (readErrorHandler == nil) {
+			return nil, werr
+		}
+		if herr := readErrorHandler(werr); herr != nil {
+			return nil, herr
+		}
+		errs.Add(werr)
+	}
 	thisNode.Parent = parentNode
+	registerNodeIndex(&thisNode)
+	nodePath := path.Append(thisNode.Name, &thisNode)
 	if (thisNode.Children > 0) {
                thisNode.Child = make([]*def.Node_t, thisNode.Children)
 	}
 	var childNo uint8
 	for childNo = 0 ; childNo < thisNode.Children ; childNo++ {
-		thisNode.Child[childNo] = traverseAndReadNode(&thisNode)
+		child, err := traverseAndReadNode(&thisNode, nodePath, errs)
+		if (err != nil) {
+			return nil, err
+		}
+		thisNode.Child[childNo] = child
 	}
+	def.PopulateProperties(&thisNode)
 	updateReadMetadata(false)
-	return &thisNode
+	return &thisNode, nil
 }
 
 func traverseAndWriteNode(node *def.Node_t) {
@@ -150,199 +178,272 @@ func traverseAndWriteNode(node *def.Node_t) {
 	}
 }
 
-func traverseNode(thisNode *def.Node_t, context *SearchContext_t) int {
-	speculationSucceded := 0
-
-	incDepth(thisNode, context)
-//	fmt.Printf("before compareNodeName():VSSnodename=%s, pathnodename=%s\n", VSSgetName(thisNode), getPathSegment(0, context))
-	if (compareNodeName(VSSgetName(thisNode), getPathSegment(0, context)) == true) {
-		var done bool
-		speculationSucceded = saveMatchingNode(thisNode, context, &done)
-		if (done == false) {
-			numOfChildren := VSSgetNumOfChildren(thisNode)
-			childPathName := getPathSegment(1, context)
-			for i := 0 ; i < numOfChildren ; i++ {
-				if (compareNodeName(VSSgetName(VSSgetChild(thisNode, i)), childPathName) == true) {
-					speculationSucceded += traverseNode(VSSgetChild(thisNode, i), context)
-				}
-			}
-		}
-	}
-	decDepth(speculationSucceded, context)
-	return speculationSucceded
-}
-
-func saveMatchingNode(thisNode *def.Node_t, context *SearchContext_t, done *bool) int {
-	if (getPathSegment(0, context) == "*") {
-		context.SpeculationIndex++
-	}
-	if (VSSgetValidation(thisNode) > context.MaxValidation) {
-		context.MaxValidation = VSSgetValidation(thisNode)  // TODO handle speculative setting?
-	}
-	if (VSSgetType(thisNode) != def.BRANCH || context.LeafNodesOnly == false) {
-		if ( isGetLeafNodeList == false && isGetUuidList == false) {
-			context.SearchData[context.NumOfMatches].NodePath = context.MatchPath
-			context.SearchData[context.NumOfMatches].NodeHandle = thisNode
-		} else {
-			if (isGetLeafNodeList == true) {
-			    if (context.NumOfMatches == 0) {
-				    context.ListFp.Write([]byte("\""))
-			    } else {
-				    context.ListFp.Write([]byte(", \""))
-			    }
-			    context.ListFp.Write([]byte(context.MatchPath))
-			    context.ListFp.Write([]byte("\""))
-			} else {
-			    if (context.NumOfMatches == 0) {
-				    context.ListFp.Write([]byte("{\"path\":\""))
-			    } else {
-				    context.ListFp.Write([]byte(", {\"path\":\""))
-			    }
-			    context.ListFp.Write([]byte(context.MatchPath))
-			    context.ListFp.Write([]byte("\", \"uuid\":\""))
-			    uuid := VSSgetUUID(thisNode)
-			    context.ListFp.Write([]byte(uuid))
-			    context.ListFp.Write([]byte("\"}"))
-			}
-		}
-		context.NumOfMatches++
-		if (context.SpeculationIndex >= 0) {
-			context.SpeculativeMatches[context.SpeculationIndex]++
-		}
-	}
-	if (VSSgetNumOfChildren(thisNode) == 0 || context.CurrentDepth == context.MaxDepth  || isEndOfScope(context) == true) {
-		*done = true
-	} else {
-		*done = false
-	}
-	if (context.SpeculationIndex >= 0 && ((VSSgetNumOfChildren(thisNode) == 0 && context.CurrentDepth >= countSegments(context.SearchPath)) || context.CurrentDepth == context.MaxDepth)) {
-		return 1
+func compareNodeName(nodeName string, pathName string) bool {
+	//fmt.Printf("compareNodeName(): nodeName=%s, pathName=%s\n", nodeName, pathName)
+	if (nodeName == pathName || pathName == "*") {
+		return true
 	}
-	return 0
+	return false
 }
 
-func isEndOfScope(context *SearchContext_t) bool {
-    if (context.ListSize == 0) {
+func isEndOfScope(matchPath string, listSize int, noScopeList []string) bool {
+    if (listSize == 0) {
         return false
     }
-    for i := 0 ; i < context.ListSize ; i++ {
-        if (context.MatchPath == context.NoScopeList[i]) {
+    for i := 0 ; i < listSize ; i++ {
+        if (matchPath == noScopeList[i]) {
             return true
         }
     }
     return false
 }
 
-func compareNodeName(nodeName string, pathName string) bool {
-	//fmt.Printf("compareNodeName(): nodeName=%s, pathName=%s\n", nodeName, pathName)
-	if (nodeName == pathName || pathName == "*") {
-		return true
+// searchFrame tracks, for one currently-open node in searchNodesWalk's
+// depth-first descent, whether its own path segment was a "*" wildcard and
+// whether any match recorded under it (itself or a descendant) reached a
+// valid end of the search path, so a speculative "*" match that dead-ends
+// can be undone once its whole subtree is known to have failed.
+type searchFrame struct {
+	wasWildcard bool
+	done        bool
+	succeeded   int
+}
+
+// searchNodesWalk is the WalkTree-driven engine behind VSSsearchNodes and
+// Parser.SearchNodes: it descends rootNode matching searchPath segment by
+// segment (a segment of "*" matches any single node name), recording every
+// node it matches along the way, and backs a speculative "*" match out again
+// if nothing beneath it reaches the end of searchPath (or listSize/maxDepth
+// cutoff). ctx may be nil; when set and canceled, the walk aborts early and
+// ctx.Err() is returned.
+func searchNodesWalk(ctx context.Context, searchPath string, rootNode *def.Node_t, maxFound int, anyDepth bool, leafNodesOnly bool, listSize int, noScopeList []string) ([]SearchData_t, int, int, error) {
+	searchData := make([]SearchData_t, maxFound)
+	segs := strings.Split(searchPath, ".")
+	maxDepth := len(segs)
+	if (anyDepth == true) {
+		maxDepth = 100  // jan 2020 max tree depth = 8
 	}
-	return false
-}
+	trailingWildcard := len(searchPath) > 0 && searchPath[len(searchPath)-1] == '*'
 
-func pushPathSegment(name string, context *SearchContext_t) {
-	if (context.CurrentDepth > 0) {
-		context.MatchPath += "."
+	segmentAt := func(depth int) string {
+		if (depth-1 < len(segs)) {
+			return segs[depth-1]
+		}
+		if (trailingWildcard == true && depth <= maxDepth) {
+			return "*"
+		}
+		return ""
 	}
-	context.MatchPath += name
-}
 
-func popPathSegment(context *SearchContext_t) {
-	delim := strings.LastIndex(context.MatchPath, ".")
-	if (delim == -1) {
-		context.MatchPath = ""
-	} else {
-		context.MatchPath = context.MatchPath[:delim]
-	}
-}
+	numOfMatches := 0
+	maxValidation := 0
+	speculationIndex := -1
+	var speculativeMatches [20]int
+	var stack []*searchFrame
 
-func getPathSegment(offset int, context *SearchContext_t) string {
-	frontDelimiter := 0
-	for i := 1 ; i < context.CurrentDepth + offset ; i++ {
-		frontDelimiter += strings.Index(context.SearchPath[frontDelimiter+1:], ".") + 1
-		if (frontDelimiter == -1) {
-			if (context.SearchPath[len(context.SearchPath)-1] == '*' && context.CurrentDepth < context.MaxDepth) {
-				return "*"
-			} else {
-				return ""
+	walkErr := WalkTree(rootNode, TreeWalkHandler{
+		PreNode: func(path Path, node *def.Node_t) error {
+			if (ctx != nil && ctx.Err() != nil) {
+				return ctx.Err()
 			}
-		}
+			if (len(stack) > 0 && stack[len(stack)-1].done == true) {
+				return fs.SkipDir
+			}
+			depth := path.Len()
+			if (depth >= 2) {
+				parent := path.Segment(-2).Node
+				if (VSSgetType(parent) == def.STRUCT && VSSgetType(node) == def.PROPERTY && expandStructProperties == false) {
+					return fs.SkipDir  // keep the STRUCT's internals opaque
+				}
+			}
+			segment := segmentAt(depth)
+			if (compareNodeName(VSSgetName(node), segment) == false) {
+				return fs.SkipDir
+			}
+			wasWildcard := segment == "*"
+			if (wasWildcard == true) {
+				speculationIndex++
+			}
+			stack = append(stack, &searchFrame{wasWildcard: wasWildcard})
+			return nil
+		},
+		Node: func(path Path, node *def.Node_t) error {
+			depth := path.Len()
+			frame := stack[len(stack)-1]
+			if (VSSgetValidation(node) > maxValidation) {
+				maxValidation = VSSgetValidation(node)  // TODO handle speculative setting?
+			}
+			if (VSSgetType(node) != def.BRANCH || leafNodesOnly == false) {
+				searchData[numOfMatches].NodePath = path.String()
+				searchData[numOfMatches].NodeHandle = node
+				numOfMatches++
+				if (speculationIndex >= 0) {
+					speculativeMatches[speculationIndex]++
+				}
+			}
+			leafLike := VSSgetNumOfChildren(node) == 0 || (VSSgetType(node) == def.STRUCT && expandStructProperties == false)
+			frame.done = leafLike || depth == maxDepth || isEndOfScope(path.String(), listSize, noScopeList)
+			if (speculationIndex >= 0 && ((leafLike && depth >= len(segs)) || depth == maxDepth)) {
+				frame.succeeded = 1
+			}
+			return nil
+		},
+		PostNode: func(path Path, node *def.Node_t) error {
+			frame := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			if (speculationIndex >= 0 && speculativeMatches[speculationIndex] > 0) {
+				if (frame.succeeded == 0) {  // it failed so remove a saved match
+					numOfMatches--
+					speculativeMatches[speculationIndex]--
+				}
+			}
+			if (frame.wasWildcard == true) {
+				speculationIndex--
+			}
+			if (len(stack) > 0) {
+				stack[len(stack)-1].succeeded += frame.succeeded
+			}
+			return nil
+		},
+	})
+	return searchData, numOfMatches, maxValidation, walkErr
+}
+
+// readBytes reads numOfBytes from treeFp, surfacing a truncated/EOF read as
+// an error instead of silently returning a short (or zeroed) buffer.
+func readBytes(numOfBytes uint32) ([]byte, error) {
+	if (numOfBytes == 0) {
+	    return nil, nil
 	}
-	endDelimiter := strings.Index(context.SearchPath[frontDelimiter+1:], ".") + frontDelimiter + 1
-	if (endDelimiter == frontDelimiter) {
-		endDelimiter = len(context.SearchPath)
+	buf := make([]byte, numOfBytes)
+	n, err := treeFp.Read(buf)
+	if (err != nil) {
+	    return nil, err
 	}
-	if (context.SearchPath[frontDelimiter] == '.') {
-		frontDelimiter++
+	if (n < int(numOfBytes)) {
+	    return nil, io.ErrUnexpectedEOF
 	}
-	return context.SearchPath[frontDelimiter:endDelimiter]
-}
-
-func incDepth(thisNode *def.Node_t, context *SearchContext_t) {
-	pushPathSegment(VSSgetName(thisNode), context)
-	context.CurrentDepth++
+	return buf, nil
 }
 
-/**
- * decDepth() shall reverse speculative wildcard matches that have failed, and also decrement currentDepth.
- **/
-func decDepth(speculationSucceded int, context *SearchContext_t) {
-	//fmt.Printf("decDepth():speculationSucceded=%d\n", speculationSucceded)
-	if (context.SpeculationIndex >= 0 && context.SpeculativeMatches[context.SpeculationIndex] > 0) {
-		if (speculationSucceded == 0) {  // it failed so remove a saved match
-			context.NumOfMatches--
-			context.SpeculativeMatches[context.SpeculationIndex]--
-		}
+// readLen reads an n-byte length prefix and returns it as a uint32,
+// surfacing a malformed (unrecognized size) prefix as an error rather than
+// panicking on the failed type assertion deSerializeUInt used to invite.
+func readLen(n uint32) (uint32, error) {
+	buf, err := readBytes(n)
+	if (err != nil) {
+	    return 0, err
 	}
-	if (getPathSegment(0, context) == "*") {
-		context.SpeculationIndex--
+	switch v := deSerializeUInt(buf).(type) {
+	case uint8:
+	    return uint32(v), nil
+	case uint16:
+	    return uint32(v), nil
+	case uint32:
+	    return v, nil
+	default:
+	    return 0, fmt.Errorf("malformed %d-byte length prefix", n)
 	}
-	popPathSegment(context)
-	context.CurrentDepth--
 }
 
-func readBytes(numOfBytes uint32) []byte {
-	if (numOfBytes > 0) {
-	    buf := make([]byte, numOfBytes)
-	    treeFp.Read(buf)
-	    return buf
+func readStr(n uint32) (string, error) {
+	buf, err := readBytes(n)
+	if (err != nil) {
+	    return "", err
 	}
-	return nil
+	return string(buf), nil
 }
 
 // The reading order must be synchronized with the writing order in the binary tool
-func populateNode(thisNode *def.Node_t) {
-	NameLen := deSerializeUInt(readBytes(1)).(uint8)
-	thisNode.Name = string(readBytes((uint32)(NameLen)))
+func populateNode(thisNode *def.Node_t) error {
+	nameLen, err := readLen(1)
+	if (err != nil) {
+	    return err
+	}
+	thisNode.Name, err = readStr(nameLen)
+	if (err != nil) {
+	    return err
+	}
 
-	NodeTypeLen := deSerializeUInt(readBytes(1)).(uint8)
-	NodeType := string(readBytes((uint32)(NodeTypeLen)))
-	thisNode.NodeType = (def.NodeTypes_t)(def.StringToNodetype(NodeType))
+	nodeTypeLen, err := readLen(1)
+	if (err != nil) {
+	    return err
+	}
+	nodeTypeStr, err := readStr(nodeTypeLen)
+	if (err != nil) {
+	    return err
+	}
+	nodeType := def.StringToNodetype(nodeTypeStr)
+	if (nodeType == 0) {
+	    return fmt.Errorf("unknown node type %q", nodeTypeStr)
+	}
+	thisNode.NodeType = (def.NodeTypes_t)(nodeType)
 
-	UuidLen := deSerializeUInt(readBytes(1)).(uint8)
-	thisNode.Uuid = string(readBytes((uint32)(UuidLen)))
+	uuidLen, err := readLen(1)
+	if (err != nil) {
+	    return err
+	}
+	thisNode.Uuid, err = readStr(uuidLen)
+	if (err != nil) {
+	    return err
+	}
 
-	DescrLen := deSerializeUInt(readBytes(2)).(uint16)
-	thisNode.Description = string(readBytes((uint32)(DescrLen)))
+	descrLen, err := readLen(2)
+	if (err != nil) {
+	    return err
+	}
+	thisNode.Description, err = readStr(descrLen)
+	if (err != nil) {
+	    return err
+	}
 
-	DatatypeLen := deSerializeUInt(readBytes(1)).(uint8)
-	Datatype := string(readBytes((uint32)(DatatypeLen)))
+	datatypeLen, err := readLen(1)
+	if (err != nil) {
+	    return err
+	}
+	Datatype, err := readStr(datatypeLen)
+	if (err != nil) {
+	    return err
+	}
 	if (thisNode.NodeType != def.BRANCH) {
-	    thisNode.Datatype = (def.NodeDatatypes_t)(def.StringToDataType(Datatype))
+	    thisNode.Datatype = Datatype
 	}
 
-	MinLen := deSerializeUInt(readBytes(1)).(uint8)
-	thisNode.Min = string(readBytes((uint32)(MinLen)))
+	minLen, err := readLen(1)
+	if (err != nil) {
+	    return err
+	}
+	thisNode.Min, err = readStr(minLen)
+	if (err != nil) {
+	    return err
+	}
 
-	MaxLen := deSerializeUInt(readBytes(1)).(uint8)
-	thisNode.Max = string(readBytes((uint32)(MaxLen)))
+	maxLen, err := readLen(1)
+	if (err != nil) {
+	    return err
+	}
+	thisNode.Max, err = readStr(maxLen)
+	if (err != nil) {
+	    return err
+	}
 
-	UnitLen := deSerializeUInt(readBytes(1)).(uint8)
-	thisNode.Unit = string(readBytes((uint32)(UnitLen)))
+	unitLen, err := readLen(1)
+	if (err != nil) {
+	    return err
+	}
+	thisNode.Unit, err = readStr(unitLen)
+	if (err != nil) {
+	    return err
+	}
 
-	allowedStrLen := deSerializeUInt(readBytes(2)).(uint16)
-	allowedStr := string(readBytes((uint32)(allowedStrLen)))
+	allowedStrLen, err := readLen(2)
+	if (err != nil) {
+	    return err
+	}
+	allowedStr, err := readStr(allowedStrLen)
+	if (err != nil) {
+	    return err
+	}
 	thisNode.Allowed = (uint8)(countAllowedElements(allowedStr))
 	if (thisNode.Allowed > 0) {
             thisNode.AllowedDef = make([]string, thisNode.Allowed)
@@ -351,16 +452,33 @@ func populateNode(thisNode *def.Node_t) {
 	    thisNode.AllowedDef[i] = extractAllowedElement(allowedStr, i)
 	}
 
-	DefaultLen := deSerializeUInt(readBytes(1)).(uint8)
-	thisNode.DefaultAllowed = string(readBytes((uint32)(DefaultLen)))
+	defaultLen, err := readLen(1)
+	if (err != nil) {
+	    return err
+	}
+	thisNode.DefaultAllowed, err = readStr(defaultLen)
+	if (err != nil) {
+	    return err
+	}
 
-	ValidateLen := deSerializeUInt(readBytes(1)).(uint8)
-	Validate := string(readBytes((uint32)(ValidateLen)))
+	validateLen, err := readLen(1)
+	if (err != nil) {
+	    return err
+	}
+	Validate, err := readStr(validateLen)
+	if (err != nil) {
+	    return err
+	}
 	thisNode.Validate = def.ValidateToInt(Validate)
 
-	thisNode.Children = deSerializeUInt(readBytes(1)).(uint8)
+	children, err := readLen(1)
+	if (err != nil) {
+	    return err
+	}
+	thisNode.Children = uint8(children)
 
 //	fmt.Printf("populateNode: %s\n", thisNode.Name)
+	return nil
 }
 
 // The reading order must be synchronized with the writing order in the binary tool
@@ -378,7 +496,7 @@ func writeNode(thisNode *def.Node_t) {
     treeFp.Write(serializeUInt((uint16)(len(thisNode.Description))))
     treeFp.Write([]byte(thisNode.Description))
 
-    Datatype := def.DataTypeToString(thisNode.Datatype)
+    Datatype := thisNode.Datatype
     treeFp.Write(serializeUInt((uint8)(len(Datatype))))
     if (len(Datatype) > 0) {
         treeFp.Write([]byte(Datatype))
@@ -481,128 +599,172 @@ func deSerializeUInt(buf []byte) interface{} {
     }
 }
 
-func countSegments(path string) int {
-    count := strings.Count(path, ".")
-    return count + 1
-}
-
-func initContext(context *SearchContext_t, searchPath string, rootNode *def.Node_t, maxFound int, searchData []SearchData_t, anyDepth bool, leafNodesOnly bool, listSize int, noScopeList []string) {
-	context.SearchPath = searchPath
-	/*    if (anyDepth == true && context.SearchPath[len(context.SearchPath)-1] != '*') {
-		  context.SearchPath = append(context.SearchPath, ".*")
-		  } */
-	context.RootNode = rootNode
-	context.MaxFound = maxFound
-	context.SearchData = searchData
-	if (anyDepth == true) {
-		context.MaxDepth = 100  //jan 2020 max tree depth = 8
-	} else {
-		context.MaxDepth = countSegments(context.SearchPath)
-	}
-	context.LeafNodesOnly = leafNodesOnly
-	context.ListSize = listSize
- 	context.NoScopeList = nil
-	if (listSize > 0) {
-  	    context.NoScopeList = noScopeList
-	}
-	context.MaxValidation = 0
-	context.CurrentDepth = 0
-	context.MatchPath = ""
-	context.NumOfMatches = 0
-	context.SpeculationIndex = -1
-	for i := 0 ; i < 20 ; i++ {
-		context.SpeculativeMatches[i] = 0
-	}
-}
-
-func initContext_LNL(context *SearchContext_t, searchPath string, rootNode *def.Node_t, anyDepth bool, leafNodesOnly bool, listSize int, noScopeList []string) {
-	context.SearchPath = searchPath
-	context.RootNode = rootNode
-	context.MaxFound = 0
-	context.SearchData = nil
-	context.ListFp = treeFp
-	if (anyDepth == true) {
-		context.MaxDepth = 100  //jan 2020 max tree depth = 8
-	} else {
-		context.MaxDepth = countSegments(context.SearchPath)
-	}
-	context.LeafNodesOnly = leafNodesOnly
-	context.ListSize = listSize
- 	context.NoScopeList = nil
-	if (listSize > 0) {
-  	    context.NoScopeList = noScopeList
-	}
-	context.MaxValidation = 0
-	context.CurrentDepth = 0
-	context.MatchPath = ""
-	context.NumOfMatches = 0
-	context.SpeculationIndex = -1
-	for i := 0 ; i < 20 ; i++ {
-		context.SpeculativeMatches[i] = 0
-	}
-}
-
+// VSSsearchNodes resolves searchPath (which may use "*" as a single-segment
+// wildcard) against rootNode. It is the structured-visitor counterpart to
+// VSSGetLeafNodesList/VSSGetUuidList below, driven by the same WalkTree
+// engine via searchNodesWalk rather than the speculative-match traverseNode
+// trio this package used to carry.
 func VSSsearchNodes(searchPath string, rootNode *def.Node_t, maxFound int, anyDepth bool, leafNodesOnly bool, listSize int, noScopeList []string, validation *int) ([]SearchData_t, int) {
-	var context SearchContext_t
-	searchData := make([]SearchData_t, maxFound)
-	isGetLeafNodeList = false
-	isGetUuidList = false
+	// When an index has been registered (via VSSBuildIndex + VSSUseIndex) and
+	// no noScopeList is given, answer from it instead of the full linear tree
+	// walk below; the index is consulted whatever rootNode is passed. This
+	// must stay a path-only query (Index.SearchPaths, not Index.Search) so
+	// opting into the index cannot silently turn a path lookup into a
+	// description search; that stays reachable only via Index.Search itself.
+	if (builtIndex != nil && listSize == 0) {
+		indexPattern := searchPath
+		if (anyDepth == true && strings.HasSuffix(indexPattern, ".*")) {
+			indexPattern = strings.TrimSuffix(indexPattern, "*") + "**"
+		}
+		results := builtIndex.SearchPaths(indexPattern, maxFound)
+		searchData := make([]SearchData_t, maxFound)
+		numOfMatches := 0
+		maxValidation := 0
+		for _, r := range results {
+			if (leafNodesOnly == true && VSSgetType(r.Node) == def.BRANCH) {
+				continue
+			}
+			if (expandStructProperties == false && VSSgetType(r.Node) == def.PROPERTY && VSSgetParent(r.Node) != nil && VSSgetType(VSSgetParent(r.Node)) == def.STRUCT) {
+				continue  // keep the STRUCT's internals opaque
+			}
+			searchData[numOfMatches].NodePath = r.Path
+			searchData[numOfMatches].NodeHandle = r.Node
+			if (VSSgetValidation(r.Node) > maxValidation) {
+				maxValidation = VSSgetValidation(r.Node)
+			}
+			numOfMatches++
+			if (numOfMatches >= maxFound) {
+				break
+			}
+		}
+		if (validation != nil) {
+			*validation = maxValidation
+		}
+		return searchData, numOfMatches
+	}
 
-	initContext(&context, searchPath, rootNode, maxFound, searchData, anyDepth, leafNodesOnly, listSize, noScopeList)
-	traverseNode(rootNode, &context)
+	searchData, numOfMatches, maxValidation, _ := searchNodesWalk(nil, searchPath, rootNode, maxFound, anyDepth, leafNodesOnly, listSize, noScopeList)
 	if (validation != nil) {
-		*validation = context.MaxValidation
+		*validation = maxValidation
 	}
-	return searchData, context.NumOfMatches
+	return searchData, numOfMatches
 }
 
+// VSSGetLeafNodesList and VSSGetUuidList visit every leaf under rootNode and
+// write a JSON listing to listFname. Both are plain full-tree, leaf-only
+// walks (no wildcard backtracking), so they are driven directly by the
+// generic WalkTree visitor, unlike the speculative-match bookkeeping
+// searchNodesWalk layers on top of it for VSSsearchNodes.
 func VSSGetLeafNodesList(rootNode *def.Node_t, listFname string) int {
-    var context SearchContext_t
-    isGetLeafNodeList = true
-    var err error
-    treeFp, err = os.OpenFile(listFname, os.O_RDWR|os.O_CREATE, 0755)
+    treeFp, err := os.OpenFile(listFname, os.O_RDWR|os.O_CREATE, 0755)
     if (err != nil) {
 	fmt.Printf("Could not open %s for writing tree data\n", listFname)
 	return 0
     }
+    defer treeFp.Close()
+
     treeFp.Write([]byte("{\"leafpaths\":["))
-    initContext_LNL(&context, "Vehicle.*", rootNode, true, true, 0, nil)  // anyDepth = true, leafNodesOnly = true
-    traverseNode(rootNode, &context)
+    numOfMatches := 0
+    WalkTree(rootNode, TreeWalkHandler{
+        PreNode: func(path Path, node *def.Node_t) error {
+            if (path.Len() >= 2) {
+                parent := path.Segment(-2).Node
+                if (VSSgetType(parent) == def.STRUCT && VSSgetType(node) == def.PROPERTY && expandStructProperties == false) {
+                    return fs.SkipDir  // keep the STRUCT's internals opaque; the STRUCT itself still gets emitted below
+                }
+            }
+            return nil
+        },
+        Node: func(path Path, node *def.Node_t) error {
+            if (VSSgetType(node) == def.BRANCH) {
+                return nil
+            }
+            if (numOfMatches == 0) {
+                treeFp.Write([]byte("\""))
+            } else {
+                treeFp.Write([]byte(", \""))
+            }
+            treeFp.Write([]byte(path.String()))
+            treeFp.Write([]byte("\""))
+            numOfMatches++
+            return nil
+        },
+    })
     treeFp.Write([]byte("]}"))
-    treeFp.Close()
 
-    return context.NumOfMatches
+    return numOfMatches
 }
 
 func VSSGetUuidList(rootNode *def.Node_t, listFname string) int {
-    var context SearchContext_t
-    isGetUuidList = true
-    var err error
-    treeFp, err = os.OpenFile(listFname, os.O_RDWR|os.O_CREATE, 0755)
+    treeFp, err := os.OpenFile(listFname, os.O_RDWR|os.O_CREATE, 0755)
     if (err != nil) {
 	fmt.Printf("Could not open %s for writing tree data\n", listFname)
 	return 0
     }
+    defer treeFp.Close()
+
     treeFp.Write([]byte("{\"leafuuids\":["))
-    initContext_LNL(&context, "Vehicle.*", rootNode, true, true, 0, nil)  // anyDepth = true, leafNodesOnly = true
-    traverseNode(rootNode, &context)
+    numOfMatches := 0
+    WalkTree(rootNode, TreeWalkHandler{
+        PreNode: func(path Path, node *def.Node_t) error {
+            if (path.Len() >= 2) {
+                parent := path.Segment(-2).Node
+                if (VSSgetType(parent) == def.STRUCT && VSSgetType(node) == def.PROPERTY && expandStructProperties == false) {
+                    return fs.SkipDir  // keep the STRUCT's internals opaque; the STRUCT itself still gets emitted below
+                }
+            }
+            return nil
+        },
+        Node: func(path Path, node *def.Node_t) error {
+            if (VSSgetType(node) == def.BRANCH) {
+                return nil
+            }
+            if (numOfMatches == 0) {
+                treeFp.Write([]byte("{\"path\":\""))
+            } else {
+                treeFp.Write([]byte(", {\"path\":\""))
+            }
+            treeFp.Write([]byte(path.String()))
+            treeFp.Write([]byte("\", \"uuid\":\""))
+            treeFp.Write([]byte(VSSgetUUID(node)))
+            treeFp.Write([]byte("\"}"))
+            numOfMatches++
+            return nil
+        },
+    })
     treeFp.Write([]byte("]}"))
-    treeFp.Close()
-    return context.NumOfMatches
+    return numOfMatches
 }
 
-func VSSReadTree(fname string) *def.Node_t {
+// VSSReadTree reads the full tree from fname. A non-nil error is the open
+// failure; or, with root nil, the first read error when readErrorHandler is
+// nil, or the error readErrorHandler returned to abort the read; or, with
+// the best-effort root, an *Errs aggregating every node read error that
+// readErrorHandler swallowed.
+func VSSReadTree(fname string) (*def.Node_t, error) {
     var err error
     treeFp, err = os.OpenFile(fname, os.O_RDONLY, 0644)
     if (err != nil) {
         fmt.Printf("Could not open %s for writing of tree. Error= %s\n", fname, err)
-        return nil
+        return nil, err
     }
     initReadMetadata()
-    var root *def.Node_t = traverseAndReadNode(nil)
+    activeNodeIndex = newNodeIndex()
+    errs := &Errs{}
+    root, err := traverseAndReadNode(nil, Path{}, errs)
+    if (err != nil) {
+        activeNodeIndex = nil
+        treeFp.Close()
+        return nil, err
+    }
+    for path, node := range buildNodeIndex(root).ByPath {
+        activeNodeIndex.ByPath[path] = node
+    }
+    lastNodeIndex = activeNodeIndex
+    activeNodeIndex = nil
     printReadMetadata()
     treeFp.Close()
-    return root
+    return root, errs.AsError()
 }
 
 func VSSWriteTree(fname string, root *def.Node_t) {
@@ -614,6 +776,9 @@ func VSSWriteTree(fname string, root *def.Node_t) {
     }
     traverseAndWriteNode(root)
     treeFp.Close()
+    if err := buildNodeIndex(root).WriteTo(fname); err != nil {
+        fmt.Printf("Could not write node index sidecar for %s: %s\n", fname, err)
+    }
 }
 
 func VSSgetName(nodeHandle *def.Node_t) string {
@@ -639,12 +804,12 @@ func VSSgetType(nodeHandle *def.Node_t) def.NodeTypes_t {
 	return (def.NodeTypes_t)(nodeHandle.NodeType)
 }
 
-func VSSgetDatatype(nodeHandle *def.Node_t) def.NodeDatatypes_t{
+func VSSgetDatatype(nodeHandle *def.Node_t) string {
 	nodeType := VSSgetType(nodeHandle)
 	if (nodeType != def.BRANCH) {
-		return (def.NodeDatatypes_t)(nodeHandle.Datatype)
+		return nodeHandle.Datatype
 	}
-	return 0
+	return ""
 }
 
 func VSSgetUUID(nodeHandle *def.Node_t) string {
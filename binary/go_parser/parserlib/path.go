@@ -0,0 +1,83 @@
+/**
+* (C) 2020 Geotab Inc
+*
+* All files and artifacts in this repository are licensed under the
+* provisions of the license provided by the LICENSE file in this repository.
+*
+*
+* Structured VSS tree path, replacing ad-hoc dot-joined string scanning.
+**/
+
+package parserlib
+
+import (
+    "strings"
+
+    def "github.com/COVESA/vss-tools/binary/go_parser/datamodel"
+)
+
+// PathSegment is one element of a Path: the node name at that depth, and a
+// back-pointer to the node itself.
+type PathSegment struct {
+    Name string
+    Node *def.Node_t
+}
+
+// Path is a tree path as a slice of segments, from the root down to the
+// current node. It replaces repeated strings.Index/strings.LastIndex
+// scanning of a dot-joined path string.
+type Path []PathSegment
+
+// Append returns a new Path with segment appended; it does not mutate p.
+func (p Path) Append(name string, node *def.Node_t) Path {
+    return append(append(Path(nil), p...), PathSegment{Name: name, Node: node})
+}
+
+// Pop returns a new Path with the last segment removed. Popping an empty
+// Path returns an empty Path.
+func (p Path) Pop() Path {
+    if (len(p) == 0) {
+        return p
+    }
+    return p[:len(p)-1]
+}
+
+// Len returns the number of segments in p.
+func (p Path) Len() int {
+    return len(p)
+}
+
+// Segment returns the segment at index i. A negative i counts from the end,
+// so p.Segment(-1) is the leaf segment, mirroring the TreePath API.
+func (p Path) Segment(i int) PathSegment {
+    if (i < 0) {
+        i += len(p)
+    }
+    if (i < 0 || i >= len(p)) {
+        return PathSegment{}
+    }
+    return p[i]
+}
+
+// String renders p as a dot-joined path, e.g. "Vehicle.Speed".
+func (p Path) String() string {
+    names := make([]string, len(p))
+    for i, seg := range p {
+        names[i] = seg.Name
+    }
+    return strings.Join(names, ".")
+}
+
+// HasPrefix reports whether p starts with every segment of other, compared
+// by name.
+func (p Path) HasPrefix(other Path) bool {
+    if (len(other) > len(p)) {
+        return false
+    }
+    for i := range other {
+        if (p[i].Name != other[i].Name) {
+            return false
+        }
+    }
+    return true
+}
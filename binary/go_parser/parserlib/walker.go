@@ -0,0 +1,85 @@
+/**
+* (C) 2020 Geotab Inc
+*
+* All files and artifacts in this repository are licensed under the
+* provisions of the license provided by the LICENSE file in this repository.
+*
+*
+* Visitor-based tree walker for the VSS binary tree.
+**/
+
+package parserlib
+
+import (
+    "io/fs"
+
+    def "github.com/COVESA/vss-tools/binary/go_parser/datamodel"
+)
+
+// TreeWalkHandler is the callback set driving WalkTree. Any callback may be
+// left nil. Returning fs.SkipDir from PreNode or Node skips descent into
+// that node's subtree without aborting the rest of the walk; returning
+// fs.SkipAll stops the whole walk cleanly (WalkTree returns nil); any other
+// non-nil error raised in a node below root is wrapped in a *WalkError and
+// passed to Err, which may swallow it (return nil, continue the walk) or
+// return it (or a different error) to abort. An error from root's own
+// callbacks is returned by WalkTree as is, without reaching Err.
+type TreeWalkHandler struct {
+    PreNode  func(path Path, node *def.Node_t) error
+    Node     func(path Path, node *def.Node_t) error
+    PostNode func(path Path, node *def.Node_t) error
+    Err      func(werr *WalkError) error
+}
+
+// WalkTree drives handler over every node reachable from root, depth
+// first. It replaces the flag-driven traverseNode search recursion:
+// serialization concerns (writing JSON, matching paths, collecting UUIDs)
+// become independent handlers instead of package-level booleans. Tree
+// reading and writing still go through traverseAndReadNode and
+// traverseAndWriteNode.
+func WalkTree(root *def.Node_t, handler TreeWalkHandler) error {
+    err := walkNode(root, Path{}.Append(VSSgetName(root), root), handler)
+    if (err == fs.SkipAll) {
+        return nil
+    }
+    return err
+}
+
+func walkNode(node *def.Node_t, path Path, handler TreeWalkHandler) error {
+    if (handler.PreNode != nil) {
+        if err := handler.PreNode(path, node); err != nil {
+            if (err == fs.SkipDir) {
+                return nil
+            }
+            return err
+        }
+    }
+    if (handler.Node != nil) {
+        if err := handler.Node(path, node); err != nil {
+            if (err == fs.SkipDir) {
+                return nil
+            }
+            return err
+        }
+    }
+    for i := 0 ; i < VSSgetNumOfChildren(node) ; i++ {
+        child := VSSgetChild(node, i)
+        childPath := path.Append(VSSgetName(child), child)
+        if err := walkNode(child, childPath, handler); err != nil {
+            if (err == fs.SkipAll) {
+                return err
+            }
+            if (handler.Err != nil) {
+                if werr := handler.Err(&WalkError{Path: childPath, NodeName: VSSgetName(child), Err: err}); werr != nil {
+                    return werr
+                }
+                continue
+            }
+            return err
+        }
+    }
+    if (handler.PostNode != nil) {
+        return handler.PostNode(path, node)
+    }
+    return nil
+}
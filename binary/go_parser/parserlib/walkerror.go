@@ -0,0 +1,87 @@
+/**
+* (C) 2020 Geotab Inc
+*
+* All files and artifacts in this repository are licensed under the
+* provisions of the license provided by the LICENSE file in this repository.
+*
+*
+* Typed, path-aware errors for tree reads and walks.
+**/
+
+package parserlib
+
+import (
+    "fmt"
+    "strings"
+)
+
+// WalkError is a single failure encountered while reading or walking a
+// tree, carrying enough context (the path down to the offending node, and
+// its name if known) to be useful on its own, without a surrounding stack
+// trace.
+type WalkError struct {
+    Path     Path
+    NodeName string
+    Err      error
+}
+
+func (e *WalkError) Error() string {
+    if (e.Path.Len() == 0) {
+        return fmt.Sprintf("vss: %s: %s", e.NodeName, e.Err)
+    }
+    return fmt.Sprintf("vss: %s: %s", e.Path.String(), e.Err)
+}
+
+func (e *WalkError) Unwrap() error {
+    return e.Err
+}
+
+// Errs aggregates multiple WalkErrors encountered across a single walk or
+// read, so a caller can log-and-continue through a partially corrupt tree
+// instead of aborting on the first problem.
+type Errs struct {
+    errs []*WalkError
+}
+
+// Add records a WalkError. A nil error is ignored.
+func (e *Errs) Add(err *WalkError) {
+    if (err == nil) {
+        return
+    }
+    e.errs = append(e.errs, err)
+}
+
+// HasErrors reports whether any error has been recorded.
+func (e *Errs) HasErrors() bool {
+    return len(e.errs) > 0
+}
+
+// Errors returns every WalkError recorded so far, in the order Add was
+// called.
+func (e *Errs) Errors() []*WalkError {
+    return e.errs
+}
+
+// Error satisfies the error interface so an *Errs can be returned wherever
+// a plain error is expected; it is nil-safe to call on an *Errs with no
+// recorded errors, returning an empty string.
+func (e *Errs) Error() string {
+    if (e == nil || len(e.errs) == 0) {
+        return ""
+    }
+    messages := make([]string, len(e.errs))
+    for i, err := range e.errs {
+        messages[i] = err.Error()
+    }
+    return strings.Join(messages, "; ")
+}
+
+// AsError returns e as an error if it recorded anything, or nil otherwise
+// -- letting callers write `return root, errs.AsError()` without an empty
+// non-nil error leaking out on the success path.
+func (e *Errs) AsError() error {
+    if (e == nil || len(e.errs) == 0) {
+        return nil
+    }
+    return e
+}
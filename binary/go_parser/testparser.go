@@ -30,6 +30,10 @@ func getTypeName(nodeType def.NodeTypes_t) string {
             return "ATTRIBUTE"
         case def.BRANCH:
             return "BRANCH"
+        case def.STRUCT:
+            return "STRUCT"
+        case def.PROPERTY:
+            return "PROPERTY"
         default:
             fmt.Printf("getTypeName: unknown type(%d)\n", nodeType)
             return "unknown"
@@ -45,8 +49,8 @@ func showNodeData(currentNode *def.Node_t, currentChild int) {
             fmt.Printf("Allowed[%d]=%s\n", i, parser.VSSgetAllowedElement(currentNode, i))
         }
         dtype := parser.VSSgetDatatype(currentNode)
-        if (dtype != 0) {
-            fmt.Printf("Datatype = %d\n", dtype)
+        if (len(dtype) != 0) {
+            fmt.Printf("Datatype = %s\n", dtype)
         }
         tmp := parser.VSSgetUnit(currentNode)
         if (len(tmp) != 0) {
@@ -59,7 +63,12 @@ func main() {
         fmt.Printf("testparser command line: ./testparser filename\n")
 	os.Exit(1)
     }
-    root = parser.VSSReadTree(os.Args[1])
+    var err error
+    root, err = parser.VSSReadTree(os.Args[1])
+    if (err != nil) {
+        fmt.Printf("Error reading tree: %s\n", err)
+        os.Exit(1)
+    }
     fmt.Printf("VSS tree root name = %s\n", parser.VSSgetName(root))
     var traverse string
     fmt.Printf("\nTo traverse the tree, 'u'(p)p/'d'(own)/'l'(eft)/'r'(ight)/s(earch)/m(etadata subtree)/n(odelist)/(uu)i(dlist)/w(rite to file)/h(elp), or any other to quit\n")
@@ -100,7 +109,7 @@ func main() {
                 fmt.Printf("\nNumber of elements found=%d\n", foundResponses)
                 for i := 0 ; i < foundResponses ; i++ {
                     fmt.Printf("Found node type=%s\n", getTypeName(parser.VSSgetType(searchData[i].NodeHandle)))
-                    fmt.Printf("Found node datatype=%d\n", parser.VSSgetDatatype(searchData[i].NodeHandle))
+                    fmt.Printf("Found node datatype=%s\n", parser.VSSgetDatatype(searchData[i].NodeHandle))
                     fmt.Printf("Found path=%s\n", searchData[i].NodePath)
                 }
             }